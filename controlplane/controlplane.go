@@ -6,12 +6,14 @@
 package controlplane
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"slices"
 	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
 	"github.com/siderolabs/go-loadbalancer/loadbalancer"
@@ -52,6 +54,23 @@ func WithTCPUserTimeout(timeout time.Duration) LoadBalancerOption {
 	}
 }
 
+// WithProxyProtocol prepends a PROXY protocol header of the given version (1 or 2) to each
+// connection dialed to an upstream, preserving the original client source address.
+func WithProxyProtocol(version int) LoadBalancerOption {
+	return func(lb *LoadBalancer) {
+		lb.lb.ProxyProtocolVersion = version
+	}
+}
+
+// WithPolicy configures the load-balancing policy used to pick an upstream for each new connection.
+//
+// If not set, the load balancer defaults to round-robin selection.
+func WithPolicy(policy upstream.Policy) LoadBalancerOption {
+	return func(lb *LoadBalancer) {
+		lb.lb.Policy = policy
+	}
+}
+
 // WithHealthCheckOptions configures the health check options.
 func WithHealthCheckOptions(options ...upstream.ListOption) LoadBalancerOption {
 	return func(lb *LoadBalancer) {
@@ -59,6 +78,23 @@ func WithHealthCheckOptions(options ...upstream.ListOption) LoadBalancerOption {
 	}
 }
 
+// WithKubernetesAPIServerHealthCheck enables active HTTP(S) health probing of each upstream's
+// Kubernetes API server readiness endpoint, in place of the default TCP-level probe.
+func WithKubernetesAPIServerHealthCheck(options ...upstream.HTTPHealthCheckOption) LoadBalancerOption {
+	return func(lb *LoadBalancer) {
+		lb.healthCheckOptions = append(lb.healthCheckOptions, upstream.WithHTTPHealthCheck(options...))
+	}
+}
+
+// WithOutlierDetection enables ejecting upstreams which fail consecutive health check probes from
+// the rotation, with exponential backoff before they are reconsidered. Only probe results count:
+// failed dials of proxied client connections do not contribute to ejection.
+func WithOutlierDetection(options ...upstream.OutlierDetectionOption) LoadBalancerOption {
+	return func(lb *LoadBalancer) {
+		lb.healthCheckOptions = append(lb.healthCheckOptions, upstream.WithOutlierDetection(options...))
+	}
+}
+
 // NewLoadBalancer initializes the load balancer.
 //
 // If bindPort is zero, load balancer will bind to a random available port.
@@ -133,6 +169,42 @@ func (lb *LoadBalancer) Start(upstreamCh <-chan []string) error {
 	return nil
 }
 
+// StartEndpoints is like Start, but accepts a channel of upstream.Endpoint values carrying
+// per-upstream weight and priority tier, enabling weighted and priority-tiered load balancing.
+//
+// Load balancer starts with an empty list of endpoints, so initial list should be provided on the channel.
+func (lb *LoadBalancer) StartEndpoints(endpointCh <-chan []upstream.Endpoint) error {
+	if err := lb.lb.Start(); err != nil {
+		return err
+	}
+
+	lb.done = make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case endpoints := <-endpointCh:
+				if err := lb.lb.ReconcileRouteEndpoints(lb.endpoint, slices.Values(endpoints)); err != nil {
+					lb.lb.Logger.Warn("failed reconciling list of upstream endpoints",
+						zap.Any("endpoints", endpoints),
+						zap.Error(err),
+					)
+				}
+			case <-lb.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Collector returns a prometheus.Collector exposing per-upstream connection and health metrics
+// for this load balancer. Callers are responsible for registering it with their own registry.
+func (lb *LoadBalancer) Collector() prometheus.Collector {
+	return lb.lb.Collector()
+}
+
 // Healthy returns true if at least one upstream is available.
 func (lb *LoadBalancer) Healthy() (bool, error) {
 	return lb.lb.IsRouteHealthy(lb.endpoint)
@@ -140,15 +212,61 @@ func (lb *LoadBalancer) Healthy() (bool, error) {
 
 // Shutdown the loadbalancer listener and wait for the connections to be closed.
 func (lb *LoadBalancer) Shutdown() error {
+	return lb.ShutdownContext(context.Background())
+}
+
+// ShutdownContext gracefully shuts down the load balancer: it stops accepting new connections
+// immediately, marks all upstreams as draining so in-flight connections are no longer routed to
+// on reconnect, and waits for in-flight connections to finish until ctx is done. Any connections
+// still open once ctx expires are forcibly closed, and the returned error, if non-nil, reports
+// how many were force-closed.
+func (lb *LoadBalancer) ShutdownContext(ctx context.Context) error {
 	if err := lb.lb.Close(); err != nil {
 		return err
 	}
 
 	close(lb.done)
 
-	lb.lb.Wait() //nolint:errcheck
+	if err := lb.lb.DrainRoute(lb.endpoint); err != nil {
+		return err
+	}
 
-	return nil
+	waitCh := make(chan struct{})
+
+	go func() {
+		defer close(waitCh)
+
+		lb.lb.Wait() //nolint:errcheck
+	}()
+
+	select {
+	case <-waitCh:
+		return nil
+	case <-ctx.Done():
+		closed, err := lb.lb.ForceClose()
+		if err != nil {
+			return err
+		}
+
+		if closed > 0 {
+			return fmt.Errorf("force-closed %d connection(s) after shutdown deadline", closed)
+		}
+
+		return nil
+	}
+}
+
+// Drain removes a single upstream from selection without killing its existing connections, so
+// that e.g. in-flight kubectl port-forwards survive until the client disconnects. It is intended
+// for rolling control-plane upgrades where an upstream is about to be replaced.
+func (lb *LoadBalancer) Drain(upstreamEndpoint string) error {
+	return lb.lb.DrainUpstream(lb.endpoint, upstreamEndpoint)
+}
+
+// EjectedEndpoints returns the addresses of upstreams currently ejected by outlier detection, for
+// observability. It is always empty unless WithOutlierDetection was configured.
+func (lb *LoadBalancer) EjectedEndpoints() ([]string, error) {
+	return lb.lb.EjectedEndpoints(lb.endpoint)
 }
 
 func findListenPort(address string) (int, error) {
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/loadbalancer"
+)
+
+func TestDrainUpstreamRemovesItFromSelection(t *testing.T) {
+	t.Parallel()
+
+	upstreamLn := listenAndAccept(t)
+	bindAddr := freeAddr(t)
+
+	lb := &loadbalancer.TCP{}
+
+	require.NoError(t, lb.AddRoute(bindAddr, []string{upstreamLn.Addr().String()}))
+	require.NoError(t, lb.Start())
+	t.Cleanup(func() { lb.Close() }) //nolint:errcheck
+
+	require.Eventually(t, func() bool {
+		healthy, err := lb.IsRouteHealthy(bindAddr)
+
+		return err == nil && healthy
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, lb.DrainUpstream(bindAddr, upstreamLn.Addr().String()))
+
+	require.Eventually(t, func() bool {
+		healthy, err := lb.IsRouteHealthy(bindAddr)
+
+		return err == nil && !healthy
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Error(t, lb.DrainUpstream(bindAddr, "127.0.0.1:1"), "draining an untracked upstream should error")
+	assert.Error(t, lb.DrainRoute("127.0.0.1:1"), "draining an untracked route should error")
+}
+
+func TestForceCloseClosesInFlightConnections(t *testing.T) {
+	t.Parallel()
+
+	upstreamLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { upstreamLn.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := upstreamLn.Accept()
+			if err != nil {
+				return
+			}
+
+			// Hold the connection open without reading or writing, so proxying blocks until
+			// force-closed.
+			t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+		}
+	}()
+
+	bindAddr := freeAddr(t)
+
+	lb := &loadbalancer.TCP{}
+
+	require.NoError(t, lb.AddRoute(bindAddr, []string{upstreamLn.Addr().String()}))
+	require.NoError(t, lb.Start())
+	t.Cleanup(func() { lb.Close() }) //nolint:errcheck
+
+	require.Eventually(t, func() bool {
+		healthy, err := lb.IsRouteHealthy(bindAddr)
+
+		return err == nil && healthy
+	}, time.Second, 5*time.Millisecond)
+
+	conn, err := net.Dial("tcp", bindAddr)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	closed, err := lb.ForceClose()
+	require.NoError(t, err)
+	assert.Equal(t, 1, closed)
+
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.ErrorIs(t, err, io.EOF, "the client connection should observe EOF once force-closed")
+}
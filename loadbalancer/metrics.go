@@ -0,0 +1,109 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// upstreamSnapshot captures the current health/ejection state of a single upstream, for the
+// upstream_healthy and upstream_ejected gauges, which reflect live state rather than discrete
+// events.
+type upstreamSnapshot struct {
+	addr    string
+	healthy bool
+	ejected bool
+}
+
+// metrics holds the Prometheus instrumentation for a TCP load balancer. It implements
+// prometheus.Collector by delegating to each underlying metric.
+type metrics struct {
+	connectionsActive *prometheus.GaugeVec
+	connectionsTotal  *prometheus.CounterVec
+	dialErrorsTotal   *prometheus.CounterVec
+	dialDuration      *prometheus.HistogramVec
+	bytesForwarded    *prometheus.CounterVec
+
+	upstreamHealthyDesc *prometheus.Desc
+	upstreamEjectedDesc *prometheus.Desc
+
+	// snapshot returns the current state of every tracked upstream across all routes, used to
+	// compute upstreamHealthyDesc/upstreamEjectedDesc at collection time.
+	snapshot func() []upstreamSnapshot
+}
+
+func newMetrics(snapshot func() []upstreamSnapshot) *metrics {
+	return &metrics{
+		connectionsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "loadbalancer",
+			Name:      "connections_active",
+			Help:      "Number of connections currently proxied to an upstream.",
+		}, []string{"route", "upstream"}),
+		connectionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loadbalancer",
+			Name:      "connections_total",
+			Help:      "Total number of connections accepted on a route, by outcome.",
+		}, []string{"route", "upstream", "result"}),
+		dialErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loadbalancer",
+			Name:      "dial_errors_total",
+			Help:      "Total number of failed dials to an upstream.",
+		}, []string{"route", "upstream"}),
+		dialDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "loadbalancer",
+			Name:      "dial_duration_seconds",
+			Help:      "Latency of successful dials to an upstream.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "upstream"}),
+		bytesForwarded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loadbalancer",
+			Name:      "bytes_forwarded_total",
+			Help:      "Total bytes proxied to or from an upstream.",
+		}, []string{"upstream", "direction"}),
+		upstreamHealthyDesc: prometheus.NewDesc(
+			"loadbalancer_upstream_healthy",
+			"Whether an upstream currently passes its health check (1) or not (0).",
+			[]string{"upstream"}, nil,
+		),
+		upstreamEjectedDesc: prometheus.NewDesc(
+			"loadbalancer_upstream_ejected",
+			"Whether an upstream is currently ejected by outlier detection (1) or not (0).",
+			[]string{"upstream"}, nil,
+		),
+		snapshot: snapshot,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.connectionsActive.Describe(ch)
+	m.connectionsTotal.Describe(ch)
+	m.dialErrorsTotal.Describe(ch)
+	m.dialDuration.Describe(ch)
+	m.bytesForwarded.Describe(ch)
+
+	ch <- m.upstreamHealthyDesc
+	ch <- m.upstreamEjectedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	m.connectionsActive.Collect(ch)
+	m.connectionsTotal.Collect(ch)
+	m.dialErrorsTotal.Collect(ch)
+	m.dialDuration.Collect(ch)
+	m.bytesForwarded.Collect(ch)
+
+	for _, s := range m.snapshot() {
+		ch <- prometheus.MustNewConstMetric(m.upstreamHealthyDesc, prometheus.GaugeValue, boolToFloat(s.healthy), s.addr)
+		ch <- prometheus.MustNewConstMetric(m.upstreamEjectedDesc, prometheus.GaugeValue, boolToFloat(s.ejected), s.addr)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
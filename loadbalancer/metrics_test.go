@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/loadbalancer"
+)
+
+func listenAndAccept(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close() //nolint:errcheck
+		}
+	}()
+
+	return ln
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := ln.Addr().String()
+
+	require.NoError(t, ln.Close())
+
+	return addr
+}
+
+// listenAndDrain behaves like listenAndAccept, but reads and discards data instead of closing the
+// connection immediately, so bytes written by a client are actually forwarded to it.
+func listenAndDrain(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close() //nolint:errcheck
+
+				io.Copy(io.Discard, conn) //nolint:errcheck
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func TestCollectorReportsConnectionMetrics(t *testing.T) {
+	t.Parallel()
+
+	upstreamLn := listenAndDrain(t)
+	upstreamAddr := upstreamLn.Addr().String()
+	bindAddr := freeAddr(t)
+
+	lb := &loadbalancer.TCP{}
+
+	require.NoError(t, lb.AddRoute(bindAddr, []string{upstreamAddr}))
+	require.NoError(t, lb.Start())
+	t.Cleanup(func() { lb.Close() }) //nolint:errcheck
+
+	require.Eventually(t, func() bool {
+		healthy, err := lb.IsRouteHealthy(bindAddr)
+
+		return err == nil && healthy
+	}, time.Second, 5*time.Millisecond)
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(lb.Collector()))
+
+	require.Eventually(t, func() bool {
+		return metricValue(t, registry, "loadbalancer_upstream_healthy", prometheus.Labels{"upstream": upstreamAddr}) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	conn, err := net.Dial("tcp", bindAddr)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	labels := prometheus.Labels{"route": bindAddr, "upstream": upstreamAddr, "result": "ok"}
+
+	require.Eventually(t, func() bool {
+		return metricValue(t, registry, "loadbalancer_connections_total", labels) >= 1
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return metricValue(t, registry, "loadbalancer_bytes_forwarded_total", prometheus.Labels{"upstream": upstreamAddr, "direction": "upload"}) >= 4
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, float64(0), metricValue(t, registry, "loadbalancer_upstream_ejected", prometheus.Labels{"upstream": upstreamAddr}))
+}
+
+func TestCollectorReportsNoUpstreamAvailable(t *testing.T) {
+	t.Parallel()
+
+	bindAddr := freeAddr(t)
+
+	lb := &loadbalancer.TCP{}
+
+	require.NoError(t, lb.AddRoute(bindAddr, nil))
+	require.NoError(t, lb.Start())
+	t.Cleanup(func() { lb.Close() }) //nolint:errcheck
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(lb.Collector()))
+
+	conn, err := net.Dial("tcp", bindAddr)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	require.Eventually(t, func() bool {
+		return metricValue(t, registry, "loadbalancer_connections_total", prometheus.Labels{"route": bindAddr, "upstream": "", "result": "no_upstream"}) >= 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func metricValue(t *testing.T, g prometheus.Gatherer, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+
+	families, err := g.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			if !labelsMatch(m.GetLabel(), labels) {
+				continue
+			}
+
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func labelsMatch(pairs []*dto.LabelPair, want prometheus.Labels) bool {
+	if len(pairs) != len(want) {
+		return false
+	}
+
+	for _, p := range pairs {
+		if want[p.GetName()] != p.GetValue() {
+			return false
+		}
+	}
+
+	return true
+}
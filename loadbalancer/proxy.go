@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer
+
+import (
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+func (t *TCP) handleConn(r *route, conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	m := t.metricsCollector()
+
+	hint := upstream.PickHint{ClientAddr: conn.RemoteAddr().String()}
+
+	u := r.upstreams.Pick(hint)
+	if u == nil {
+		m.connectionsTotal.WithLabelValues(r.addr, "", "no_upstream").Inc()
+		t.logger().Warn("no healthy upstream available", zap.String("route", r.addr))
+
+		return
+	}
+
+	dialStart := time.Now()
+
+	upstreamConn, err := t.dialer().Dial("tcp", u.Addr())
+	if err != nil {
+		m.dialErrorsTotal.WithLabelValues(r.addr, u.Addr()).Inc()
+		m.connectionsTotal.WithLabelValues(r.addr, u.Addr(), "dial_error").Inc()
+		t.logger().Warn("failed dialing upstream", zap.String("upstream", u.Addr()), zap.Error(err))
+
+		return
+	}
+
+	m.connectionsTotal.WithLabelValues(r.addr, u.Addr(), "ok").Inc()
+
+	dialDuration := time.Since(dialStart)
+
+	u.RecordLatency(dialDuration)
+	m.dialDuration.WithLabelValues(r.addr, u.Addr()).Observe(dialDuration.Seconds())
+
+	defer upstreamConn.Close() //nolint:errcheck
+
+	u.IncActiveConns()
+	defer u.DecActiveConns()
+
+	m.connectionsActive.WithLabelValues(r.addr, u.Addr()).Inc()
+	defer m.connectionsActive.WithLabelValues(r.addr, u.Addr()).Dec()
+
+	t.applyKeepAlive(upstreamConn)
+
+	if t.ProxyProtocolVersion > 0 {
+		header, err := encodeProxyProtocolHeader(t.ProxyProtocolVersion, conn.RemoteAddr(), conn.LocalAddr())
+		if err != nil {
+			t.logger().Warn("failed building PROXY protocol header", zap.Error(err))
+
+			return
+		}
+
+		if _, err := upstreamConn.Write(header); err != nil {
+			t.logger().Warn("failed writing PROXY protocol header", zap.Error(err))
+
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		// client -> upstream
+		proxyHalf(upstreamConn, conn, m.bytesForwarded.WithLabelValues(u.Addr(), "upload"))
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		// upstream -> client
+		proxyHalf(conn, upstreamConn, m.bytesForwarded.WithLabelValues(u.Addr(), "download"))
+	}()
+
+	wg.Wait()
+}
+
+// proxyHalf copies src into dst until src is exhausted or errors, recording bytes forwarded
+// against counter as they are written rather than only once the copy finishes, then closes dst's
+// write half so the other direction observes EOF.
+func proxyHalf(dst, src net.Conn, counter prometheus.Counter) {
+	_, _ = io.Copy(&countingWriter{Writer: dst, counter: counter}, src)
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite() //nolint:errcheck
+	}
+}
+
+// countingWriter wraps a Writer, adding the size of every successful Write to counter.
+type countingWriter struct {
+	io.Writer
+	counter prometheus.Counter
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.counter.Add(float64(n))
+
+	return n, err
+}
+
+func (t *TCP) dialer() *net.Dialer {
+	d := &net.Dialer{Timeout: t.dialTimeout()}
+
+	if t.TCPUserTimeout > 0 {
+		timeout := t.TCPUserTimeout
+
+		d.Control = func(_, _ string, c syscall.RawConn) error {
+			var opErr error
+
+			if err := c.Control(func(fd uintptr) {
+				opErr = setTCPUserTimeout(fd, timeout)
+			}); err != nil {
+				return err
+			}
+
+			return opErr
+		}
+	}
+
+	return d
+}
+
+func (t *TCP) applyKeepAlive(conn net.Conn) {
+	if t.KeepAlivePeriod <= 0 {
+		return
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	tcpConn.SetKeepAlive(true)                    //nolint:errcheck
+	tcpConn.SetKeepAlivePeriod(t.KeepAlivePeriod) //nolint:errcheck
+}
@@ -0,0 +1,87 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// proxyProtocolV2Signature is the fixed 12-byte signature that starts every PROXY protocol v2
+// header, per the spec (https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt).
+var proxyProtocolV2Signature = [12]byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyProtocolV2VerCmd  = 0x21 // version 2, command PROXY
+	proxyProtocolV2FamTCP4 = 0x11
+	proxyProtocolV2FamTCP6 = 0x21
+)
+
+// encodeProxyProtocolHeader builds a PROXY protocol header (version 1, text, or version 2,
+// binary) describing a connection from src to dst, to be sent to the upstream ahead of the
+// proxied stream so it can recover the original client address.
+func encodeProxyProtocolHeader(version int, src, dst net.Addr) ([]byte, error) {
+	srcTCP, ok := src.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol: unsupported source address type %T", src)
+	}
+
+	dstTCP, ok := dst.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol: unsupported destination address type %T", dst)
+	}
+
+	switch version {
+	case 1:
+		return encodeProxyProtocolV1(srcTCP, dstTCP), nil
+	case 2:
+		return encodeProxyProtocolV2(srcTCP, dstTCP), nil
+	default:
+		return nil, fmt.Errorf("proxy protocol: unsupported version %d", version)
+	}
+}
+
+// encodeProxyProtocolV1 builds a PROXY protocol v1 (human-readable) header.
+func encodeProxyProtocolV1(src, dst *net.TCPAddr) []byte {
+	proto := "TCP4"
+	if src.IP.To4() == nil {
+		proto = "TCP6"
+	}
+
+	return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", proto, src.IP.String(), dst.IP.String(), src.Port, dst.Port)
+}
+
+// encodeProxyProtocolV2 builds a PROXY protocol v2 (binary) header.
+func encodeProxyProtocolV2(src, dst *net.TCPAddr) []byte {
+	var (
+		fam       byte
+		addrBlock []byte
+	)
+
+	if srcIP4, dstIP4 := src.IP.To4(), dst.IP.To4(); srcIP4 != nil && dstIP4 != nil {
+		fam = proxyProtocolV2FamTCP4
+		addrBlock = make([]byte, 12)
+		copy(addrBlock[0:4], srcIP4)
+		copy(addrBlock[4:8], dstIP4)
+		binary.BigEndian.PutUint16(addrBlock[8:10], uint16(src.Port))
+		binary.BigEndian.PutUint16(addrBlock[10:12], uint16(dst.Port))
+	} else {
+		fam = proxyProtocolV2FamTCP6
+		addrBlock = make([]byte, 36)
+		copy(addrBlock[0:16], src.IP.To16())
+		copy(addrBlock[16:32], dst.IP.To16())
+		binary.BigEndian.PutUint16(addrBlock[32:34], uint16(src.Port))
+		binary.BigEndian.PutUint16(addrBlock[34:36], uint16(dst.Port))
+	}
+
+	header := make([]byte, 0, len(proxyProtocolV2Signature)+4+len(addrBlock))
+	header = append(header, proxyProtocolV2Signature[:]...)
+	header = append(header, proxyProtocolV2VerCmd, fam)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrBlock)))
+	header = append(header, addrBlock...)
+
+	return header
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeProxyProtocolV1(t *testing.T) {
+	t.Parallel()
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56789}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}
+
+	header, err := encodeProxyProtocolHeader(1, src, dst)
+	require.NoError(t, err)
+
+	assert.Equal(t, "PROXY TCP4 192.0.2.1 198.51.100.1 56789 443\r\n", string(header))
+}
+
+func TestEncodeProxyProtocolV2TCP4(t *testing.T) {
+	t.Parallel()
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56789}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}
+
+	header, err := encodeProxyProtocolHeader(2, src, dst)
+	require.NoError(t, err)
+
+	expected := []byte{
+		0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A, // signature
+		0x21,       // version 2, command PROXY
+		0x11,       // AF_INET, STREAM
+		0x00, 0x0C, // address length: 12 bytes
+		192, 0, 2, 1, // src IP
+		198, 51, 100, 1, // dst IP
+		0xDD, 0xD5, // src port 56789
+		0x01, 0xBB, // dst port 443
+	}
+
+	assert.Equal(t, expected, header)
+}
+
+func TestEncodeProxyProtocolV2TCP6(t *testing.T) {
+	t.Parallel()
+
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56789}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	header, err := encodeProxyProtocolHeader(2, src, dst)
+	require.NoError(t, err)
+
+	require.Len(t, header, 12+4+36)
+	assert.Equal(t, byte(0x21), header[12])
+	assert.Equal(t, byte(0x21), header[13]) // AF_INET6
+	assert.Equal(t, []byte{0x00, 0x24}, header[14:16])
+}
+
+func TestEncodeProxyProtocolUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 2}
+
+	_, err := encodeProxyProtocolHeader(3, src, dst)
+	assert.Error(t, err)
+}
@@ -0,0 +1,382 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package loadbalancer implements a generic TCP load balancer with health-checked upstreams.
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+// TCP is a TCP load balancer capable of serving multiple routes, each with its own set of
+// health-checked upstreams.
+type TCP struct { //nolint:govet
+	// DialTimeout bounds each dial attempt to an upstream. Defaults to 5 seconds.
+	DialTimeout time.Duration
+	// KeepAlivePeriod configures TCP keepalive on upstream connections, if positive.
+	KeepAlivePeriod time.Duration
+	// TCPUserTimeout configures TCP_USER_TIMEOUT on upstream connections (Linux only), if positive.
+	TCPUserTimeout time.Duration
+	// Logger receives diagnostic events. Defaults to a no-op logger.
+	Logger *zap.Logger
+	// Policy selects an upstream for each new connection. Defaults to upstream.RoundRobinPolicy.
+	Policy upstream.Policy
+	// ProxyProtocolVersion, if 1 or 2, prepends a PROXY protocol header of that version to each
+	// upstream connection, preserving the original client address. Zero disables it.
+	ProxyProtocolVersion int
+
+	mu     sync.Mutex
+	routes map[string]*route
+
+	metricsOnce sync.Once
+	metrics     *metrics
+}
+
+// route holds the state for a single bind address.
+type route struct { //nolint:govet
+	addr string
+
+	upstreams *upstream.List
+
+	listener net.Listener
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	connWG sync.WaitGroup
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+func (r *route) trackConn(conn net.Conn) {
+	r.connsMu.Lock()
+	defer r.connsMu.Unlock()
+
+	if r.conns == nil {
+		r.conns = map[net.Conn]struct{}{}
+	}
+
+	r.conns[conn] = struct{}{}
+}
+
+func (r *route) untrackConn(conn net.Conn) {
+	r.connsMu.Lock()
+	defer r.connsMu.Unlock()
+
+	delete(r.conns, conn)
+}
+
+// forceCloseConns closes every currently tracked connection on the route, returning how many were
+// actually closed by this call. A connection that had already finished and closed itself on its
+// own (racing with the caller) reports an error here and is not counted, so the result reflects
+// connections this call actually severed, not ones that happened to still be in the registry.
+func (r *route) forceCloseConns() (int, error) {
+	r.connsMu.Lock()
+	defer r.connsMu.Unlock()
+
+	var (
+		errs   error
+		closed int
+	)
+
+	for conn := range r.conns {
+		if err := conn.Close(); err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			closed++
+		}
+
+		delete(r.conns, conn)
+	}
+
+	return closed, errs
+}
+
+// AddRoute registers a new route listening on addr and proxying to hosts.
+func (t *TCP) AddRoute(addr string, hosts []string, options ...upstream.ListOption) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.routes == nil {
+		t.routes = map[string]*route{}
+	}
+
+	if _, ok := t.routes[addr]; ok {
+		return fmt.Errorf("route %s already exists", addr)
+	}
+
+	listOptions := append(options, upstream.WithLogger(t.logger())) //nolint:gocritic
+
+	if t.Policy != nil {
+		listOptions = append(listOptions, upstream.WithPolicy(t.Policy))
+	}
+
+	list := upstream.NewList(listOptions...)
+
+	if err := list.Reconcile(stringsSeq(hosts)); err != nil {
+		return err
+	}
+
+	t.routes[addr] = &route{
+		addr:      addr,
+		upstreams: list,
+	}
+
+	return nil
+}
+
+// Start starts listening and proxying on every registered route.
+func (t *TCP) Start() error {
+	for _, r := range t.routeList() {
+		listener, err := net.Listen("tcp", r.addr)
+		if err != nil {
+			return fmt.Errorf("failed listening on %s: %w", r.addr, err)
+		}
+
+		r.listener = listener
+		r.ctx, r.cancel = context.WithCancel(context.Background())
+
+		r.upstreams.Start(r.ctx)
+
+		r.connWG.Add(1)
+
+		go t.acceptLoop(r)
+	}
+
+	return nil
+}
+
+// ReconcileRoute updates the list of upstreams for addr.
+func (t *TCP) ReconcileRoute(addr string, hosts iter.Seq[string]) error {
+	r, err := t.routeByAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	return r.upstreams.Reconcile(hosts)
+}
+
+// ReconcileRouteEndpoints updates the list of upstreams for addr, using typed endpoints that
+// carry per-upstream weight and priority tier for weighted/priority-tiered load balancing.
+func (t *TCP) ReconcileRouteEndpoints(addr string, endpoints iter.Seq[upstream.Endpoint]) error {
+	r, err := t.routeByAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	return r.upstreams.ReconcileEndpoints(endpoints)
+}
+
+// IsRouteHealthy reports whether addr has at least one upstream Pick could currently return: either
+// a genuinely healthy one, or, if outlier detection has ejected every upstream, the
+// least-recently-ejected one kept as a last-resort fallback (see upstream.List.Pick).
+func (t *TCP) IsRouteHealthy(addr string) (bool, error) {
+	r, err := t.routeByAddr(addr)
+	if err != nil {
+		return false, err
+	}
+
+	return r.upstreams.Healthy(), nil
+}
+
+// Close stops accepting new connections on every route. In-flight connections are left running;
+// call Wait to wait for them to finish.
+func (t *TCP) Close() error {
+	var errs error
+
+	for _, r := range t.routeList() {
+		if r.listener != nil {
+			if err := r.listener.Close(); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+
+		if r.cancel != nil {
+			r.cancel()
+		}
+
+		r.upstreams.Stop()
+	}
+
+	return errs
+}
+
+// Wait blocks until every in-flight connection across all routes has finished.
+func (t *TCP) Wait() error {
+	for _, r := range t.routeList() {
+		r.connWG.Wait()
+	}
+
+	return nil
+}
+
+func (t *TCP) acceptLoop(r *route) {
+	defer r.connWG.Done()
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.connWG.Add(1)
+		r.trackConn(conn)
+
+		go func() {
+			defer r.connWG.Done()
+			defer r.untrackConn(conn)
+
+			t.handleConn(r, conn)
+		}()
+	}
+}
+
+func (t *TCP) routeList() []*route {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes := make([]*route, 0, len(t.routes))
+	for _, r := range t.routes {
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
+func (t *TCP) routeByAddr(addr string) (*route, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.routes[addr]
+	if !ok {
+		return nil, fmt.Errorf("route %s not found", addr)
+	}
+
+	return r, nil
+}
+
+// DrainRoute marks every upstream of addr as draining, removing them all from selection without
+// affecting their live connections.
+func (t *TCP) DrainRoute(addr string) error {
+	r, err := t.routeByAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	r.upstreams.DrainAll()
+
+	return nil
+}
+
+// DrainUpstream marks a single upstream of routeAddr as draining, removing it from selection
+// without affecting its live connections. It returns an error if either the route or the upstream
+// is not tracked.
+func (t *TCP) DrainUpstream(routeAddr, upstreamAddr string) error {
+	r, err := t.routeByAddr(routeAddr)
+	if err != nil {
+		return err
+	}
+
+	return r.upstreams.Drain(upstreamAddr)
+}
+
+// EjectedEndpoints returns the addresses of upstreams of routeAddr currently ejected by outlier
+// detection, in sorted order.
+func (t *TCP) EjectedEndpoints(routeAddr string) ([]string, error) {
+	r, err := t.routeByAddr(routeAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.upstreams.EjectedEndpoints(), nil
+}
+
+// ForceClose forcibly closes every connection currently in flight across all routes, returning how
+// many were closed. It is intended as a last resort after a graceful shutdown deadline has passed.
+func (t *TCP) ForceClose() (int, error) {
+	var (
+		total int
+		errs  error
+	)
+
+	for _, r := range t.routeList() {
+		closed, err := r.forceCloseConns()
+
+		total += closed
+		errs = errors.Join(errs, err)
+	}
+
+	return total, errs
+}
+
+// Collector returns a prometheus.Collector exposing connection and dial metrics for every route
+// registered on this load balancer. Callers are responsible for registering it with their own
+// registry.
+func (t *TCP) Collector() prometheus.Collector {
+	return t.metricsCollector()
+}
+
+func (t *TCP) metricsCollector() *metrics {
+	t.metricsOnce.Do(func() {
+		t.metrics = newMetrics(t.upstreamSnapshots)
+	})
+
+	return t.metrics
+}
+
+// upstreamSnapshots returns the current health/ejection state of every upstream tracked across all
+// routes, for the upstream_healthy and upstream_ejected gauges.
+func (t *TCP) upstreamSnapshots() []upstreamSnapshot {
+	var snapshots []upstreamSnapshot
+
+	for _, r := range t.routeList() {
+		for _, u := range r.upstreams.All() {
+			snapshots = append(snapshots, upstreamSnapshot{
+				addr:    u.Addr(),
+				healthy: u.Healthy(),
+				ejected: u.Ejected(),
+			})
+		}
+	}
+
+	return snapshots
+}
+
+func (t *TCP) logger() *zap.Logger {
+	if t.Logger == nil {
+		return zap.NewNop()
+	}
+
+	return t.Logger
+}
+
+func (t *TCP) dialTimeout() time.Duration {
+	if t.DialTimeout <= 0 {
+		return 5 * time.Second
+	}
+
+	return t.DialTimeout
+}
+
+func stringsSeq(s []string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, v := range s {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
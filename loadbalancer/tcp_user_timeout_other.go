@@ -0,0 +1,14 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux
+
+package loadbalancer
+
+import "time"
+
+// setTCPUserTimeout is a no-op on platforms without TCP_USER_TIMEOUT support.
+func setTCPUserTimeout(_ uintptr, _ time.Duration) error {
+	return nil
+}
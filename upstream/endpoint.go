@@ -0,0 +1,29 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream
+
+import (
+	"net"
+	"strconv"
+)
+
+// Endpoint describes an upstream dial target along with its weight and priority tier.
+type Endpoint struct {
+	Host string
+	Port int
+
+	// Weight biases selection among upstreams in the same Priority tier: an upstream with
+	// weight 2 is picked, on average, twice as often as one with weight 1. Zero is treated as 1.
+	Weight uint32
+
+	// Priority groups upstreams into tiers. Only the lowest Priority tier with at least one
+	// healthy upstream is eligible for selection; higher-numbered tiers act as a fallback.
+	Priority uint32
+}
+
+// Addr returns the endpoint as a "host:port" string suitable for dialing.
+func (e Endpoint) Addr() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
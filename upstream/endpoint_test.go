@@ -0,0 +1,183 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+const (
+	probeInterval = 10 * time.Millisecond
+	waitTimeout   = time.Second
+)
+
+func endpointSeq(endpoints ...upstream.Endpoint) func(func(upstream.Endpoint) bool) {
+	return func(yield func(upstream.Endpoint) bool) {
+		for _, e := range endpoints {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+func splitAddr(t *testing.T, addr string) (string, int) {
+	t.Helper()
+
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	return host, port
+}
+
+func startedList(t *testing.T, options ...upstream.ListOption) *upstream.List {
+	t.Helper()
+
+	list := upstream.NewList(append(options, upstream.WithProbeInterval(probeInterval))...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	return list
+}
+
+func requireAllHealthy(t *testing.T, list *upstream.List) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		for _, u := range list.All() {
+			if !u.Healthy() {
+				return false
+			}
+		}
+
+		return true
+	}, waitTimeout, 5*time.Millisecond)
+}
+
+func TestPickPrefersLowestHealthyPriorityTier(t *testing.T) {
+	t.Parallel()
+
+	primary := listenTCP(t)
+	secondary := listenTCP(t)
+
+	primaryHost, primaryPort := splitAddr(t, primary)
+	secondaryHost, secondaryPort := splitAddr(t, secondary)
+
+	list := startedList(t, upstream.WithPolicy(&upstream.RoundRobinPolicy{}))
+
+	require.NoError(t, list.ReconcileEndpoints(endpointSeq(
+		upstream.Endpoint{Host: primaryHost, Port: primaryPort, Priority: 0},
+		upstream.Endpoint{Host: secondaryHost, Port: secondaryPort, Priority: 1},
+	)))
+
+	requireAllHealthy(t, list)
+
+	// Both tiers healthy: only tier 0 (primary) should ever be picked.
+	for range 10 {
+		u := list.Pick(upstream.PickHint{})
+		require.NotNil(t, u)
+		assert.Equal(t, uint32(0), u.Priority())
+	}
+
+	// Drain the primary tier: selection should fall back to the secondary tier.
+	require.NoError(t, list.Drain(primary))
+
+	require.Eventually(t, func() bool {
+		u := list.Pick(upstream.PickHint{})
+
+		return u != nil && u.Priority() == 1
+	}, waitTimeout, 5*time.Millisecond)
+}
+
+func TestSmoothWeightedRoundRobinInterleavesSelection(t *testing.T) {
+	t.Parallel()
+
+	heavy := listenTCP(t)
+	light := listenTCP(t)
+
+	heavyHost, heavyPort := splitAddr(t, heavy)
+	lightHost, lightPort := splitAddr(t, light)
+
+	list := startedList(t, upstream.WithPolicy(&upstream.RoundRobinPolicy{}))
+
+	require.NoError(t, list.ReconcileEndpoints(endpointSeq(
+		upstream.Endpoint{Host: heavyHost, Port: heavyPort, Weight: 3},
+		upstream.Endpoint{Host: lightHost, Port: lightPort, Weight: 1},
+	)))
+
+	requireAllHealthy(t, list)
+
+	// Over one full weight cycle (4 picks), smooth weighted round-robin interleaves the light
+	// upstream among the heavy picks instead of bunching all heavy picks first and the light one
+	// last, which is what naive "repeat each upstream Weight times, then cycle" replication does.
+	picks := make([]string, 4)
+	for i := range picks {
+		u := list.Pick(upstream.PickHint{})
+		require.NotNil(t, u)
+		picks[i] = u.Addr()
+	}
+
+	lightIdx := slices.Index(picks, light)
+	require.GreaterOrEqual(t, lightIdx, 0, "light upstream should be picked at least once per weight cycle")
+	assert.Less(t, lightIdx, 3,
+		"smooth weighted round-robin should interleave the light upstream before the last pick of the cycle, not bunch it at the end: got %v", picks)
+
+	counts := map[string]int{}
+
+	for range 40 {
+		u := list.Pick(upstream.PickHint{})
+		require.NotNil(t, u)
+		counts[u.Addr()]++
+	}
+
+	assert.Greater(t, counts[heavy], counts[light])
+}
+
+func TestRandomPolicyStillRespectsWeight(t *testing.T) {
+	t.Parallel()
+
+	heavy := listenTCP(t)
+	light := listenTCP(t)
+
+	heavyHost, heavyPort := splitAddr(t, heavy)
+	lightHost, lightPort := splitAddr(t, light)
+
+	list := startedList(t, upstream.WithPolicy(upstream.RandomPolicy{}))
+
+	require.NoError(t, list.ReconcileEndpoints(endpointSeq(
+		upstream.Endpoint{Host: heavyHost, Port: heavyPort, Weight: 9},
+		upstream.Endpoint{Host: lightHost, Port: lightPort, Weight: 1},
+	)))
+
+	requireAllHealthy(t, list)
+
+	counts := map[string]int{}
+
+	for range 200 {
+		u := list.Pick(upstream.PickHint{})
+		require.NotNil(t, u)
+		counts[u.Addr()]++
+	}
+
+	assert.Greater(t, counts[heavy], counts[light],
+		"List.Pick should still bias non-round-robin policies toward heavier upstreams")
+}
@@ -0,0 +1,449 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options configure a List.
+type Options struct {
+	// Prober actively health-checks each upstream. Defaults to TCPProber.
+	Prober Prober
+	// ProbeInterval is the time between health check rounds. Defaults to 5 seconds.
+	ProbeInterval time.Duration
+	// Logger is used to report health check state changes. Defaults to a no-op logger.
+	Logger *zap.Logger
+	// Policy selects an upstream for each new connection. Defaults to RoundRobinPolicy.
+	Policy Policy
+	// OutlierDetection, if set, ejects upstreams from selection after consecutive health check
+	// failures. Defaults to nil (disabled).
+	OutlierDetection *OutlierConfig
+}
+
+// ListOption configures Options.
+type ListOption func(*Options)
+
+// WithProber overrides the Prober used to health-check upstreams. Defaults to TCPProber.
+func WithProber(prober Prober) ListOption {
+	return func(o *Options) {
+		o.Prober = prober
+	}
+}
+
+// WithHTTPHealthCheck enables active HTTP(S) health probing in place of the default TCP-level probe.
+func WithHTTPHealthCheck(options ...HTTPHealthCheckOption) ListOption {
+	return func(o *Options) {
+		o.Prober = NewHTTPProber(options...)
+	}
+}
+
+// WithProbeInterval overrides the default interval between health check rounds.
+func WithProbeInterval(interval time.Duration) ListOption {
+	return func(o *Options) {
+		o.ProbeInterval = interval
+	}
+}
+
+// WithLogger attaches a logger used to report health check state changes.
+func WithLogger(logger *zap.Logger) ListOption {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithPolicy overrides the policy used to select an upstream for each new connection. Defaults
+// to RoundRobinPolicy.
+func WithPolicy(policy Policy) ListOption {
+	return func(o *Options) {
+		o.Policy = policy
+	}
+}
+
+// List tracks a set of upstream endpoints, actively health-checking them and exposing the
+// currently healthy set for picking.
+type List struct {
+	options Options
+
+	mu        sync.Mutex
+	upstreams map[string]*Upstream
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewList creates a List with no upstreams. Call Reconcile to populate it and Start to begin
+// active health checking.
+func NewList(options ...ListOption) *List {
+	o := Options{
+		Prober:        TCPProber{},
+		ProbeInterval: 5 * time.Second,
+		Logger:        zap.NewNop(),
+		Policy:        &RoundRobinPolicy{},
+	}
+
+	for _, option := range options {
+		option(&o)
+	}
+
+	return &List{
+		options:   o,
+		upstreams: map[string]*Upstream{},
+	}
+}
+
+// Reconcile replaces the set of tracked upstreams with hosts, preserving health state for
+// upstreams which are unchanged.
+func (l *List) Reconcile(hosts iter.Seq[string]) error {
+	next := map[string]*Upstream{}
+
+	for host := range hosts {
+		h, portStr, err := net.SplitHostPort(host)
+		if err != nil {
+			return err
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return err
+		}
+
+		addr := net.JoinHostPort(h, portStr)
+
+		if existing, ok := l.existing(addr); ok {
+			next[addr] = existing
+
+			continue
+		}
+
+		next[addr] = newUpstream(h, port)
+	}
+
+	l.mu.Lock()
+	l.upstreams = next
+	l.mu.Unlock()
+
+	return nil
+}
+
+// ReconcileEndpoints replaces the set of tracked upstreams with endpoints, preserving health
+// state for upstreams which are unchanged but always refreshing their weight and priority.
+func (l *List) ReconcileEndpoints(endpoints iter.Seq[Endpoint]) error {
+	next := map[string]*Upstream{}
+
+	for endpoint := range endpoints {
+		addr := endpoint.Addr()
+
+		u, ok := l.existing(addr)
+		if !ok {
+			u = newUpstream(endpoint.Host, endpoint.Port)
+		}
+
+		u.setWeight(endpoint.Weight)
+		u.setPriority(endpoint.Priority)
+
+		next[addr] = u
+	}
+
+	l.mu.Lock()
+	l.upstreams = next
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *List) existing(addr string) (*Upstream, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u, ok := l.upstreams[addr]
+
+	return u, ok
+}
+
+// All returns a snapshot of all tracked upstreams, regardless of health.
+func (l *List) All() []*Upstream {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	all := make([]*Upstream, 0, len(l.upstreams))
+	for _, u := range l.upstreams {
+		all = append(all, u)
+	}
+
+	return all
+}
+
+// Healthy reports whether at least one tracked upstream is currently healthy, or, failing that,
+// whether outlier detection has a least-recently-ejected upstream to fall back to.
+func (l *List) Healthy() bool {
+	for _, u := range l.All() {
+		if u.Healthy() {
+			return true
+		}
+	}
+
+	return l.leastRecentlyEjected() != nil
+}
+
+// Pick selects a healthy upstream for a new connection described by hint, using the List's
+// configured Policy. Selection is restricted to the lowest-numbered priority tier that still has
+// a healthy upstream, and upstreams are weighted within that tier. If outlier detection has
+// ejected every upstream, it falls back to the least-recently-ejected one rather than failing the
+// connection outright. It returns nil only if there is truly no upstream to pick.
+func (l *List) Pick(hint PickHint) *Upstream {
+	healthy := make([]*Upstream, 0)
+
+	for _, u := range l.All() {
+		if u.Healthy() {
+			healthy = append(healthy, u)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return l.leastRecentlyEjected()
+	}
+
+	tier := lowestHealthyTier(healthy)
+
+	// RoundRobinPolicy implements smooth weighted round-robin itself, reading Upstream.Weight
+	// directly; expanding the tier here would feed it duplicate entries per upstream and corrupt
+	// its per-address accumulators. Every other policy doesn't consider weight on its own, so fall
+	// back to biasing their input by replication, preserving Endpoint.Weight's contract for them.
+	if _, ok := l.options.Policy.(*RoundRobinPolicy); ok {
+		return l.options.Policy.Pick(tier, hint)
+	}
+
+	return l.options.Policy.Pick(expandByWeight(tier), hint)
+}
+
+// maxWeightReplicas bounds how many times a single upstream can appear in the slice handed to a
+// weight-unaware Policy, so that a pathologically large Weight cannot make selection effectively
+// O(weight).
+const maxWeightReplicas = 32
+
+// expandByWeight repeats each upstream proportionally to its Weight, so that weight-unaware
+// policies (random, least-connections, IP-hash, EWMA) still favor heavier upstreams.
+func expandByWeight(upstreams []*Upstream) []*Upstream {
+	expanded := make([]*Upstream, 0, len(upstreams))
+
+	for _, u := range upstreams {
+		replicas := int(u.Weight())
+		if replicas > maxWeightReplicas {
+			replicas = maxWeightReplicas
+		}
+
+		for range replicas {
+			expanded = append(expanded, u)
+		}
+	}
+
+	return expanded
+}
+
+// lowestHealthyTier returns the subset of healthy upstreams in the lowest-numbered Priority tier.
+func lowestHealthyTier(healthy []*Upstream) []*Upstream {
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	minPriority := healthy[0].Priority()
+
+	for _, u := range healthy[1:] {
+		if u.Priority() < minPriority {
+			minPriority = u.Priority()
+		}
+	}
+
+	tier := make([]*Upstream, 0, len(healthy))
+
+	for _, u := range healthy {
+		if u.Priority() == minPriority {
+			tier = append(tier, u)
+		}
+	}
+
+	return tier
+}
+
+// leastRecentlyEjected returns the tracked, non-draining upstream whose outlier-detection ejection
+// happened longest ago, or nil if none qualifies. It is the fallback Pick and Healthy use so that
+// outlier detection never leaves the pool with nothing to select: the upstream ejected longest ago
+// is the one most likely to have recovered. Draining upstreams are never returned, since Drain's
+// contract is that a drained upstream receives no new connections regardless of ejection state.
+func (l *List) leastRecentlyEjected() *Upstream {
+	var (
+		oldest   *Upstream
+		oldestAt time.Time
+	)
+
+	for _, u := range l.All() {
+		if u.Draining() {
+			continue
+		}
+
+		ejectedAt, ejected := u.ejectedSince()
+		if !ejected {
+			continue
+		}
+
+		if oldest == nil || ejectedAt.Before(oldestAt) {
+			oldest = u
+			oldestAt = ejectedAt
+		}
+	}
+
+	return oldest
+}
+
+// Drain marks addr as draining, removing it from selection without affecting its live connections.
+// It returns an error if addr is not tracked.
+func (l *List) Drain(addr string) error {
+	l.mu.Lock()
+	u, ok := l.upstreams[addr]
+	l.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("upstream %s is not tracked", addr)
+	}
+
+	u.setDraining(true)
+
+	return nil
+}
+
+// DrainAll marks every tracked upstream as draining.
+func (l *List) DrainAll() {
+	for _, u := range l.All() {
+		u.setDraining(true)
+	}
+}
+
+// Start begins the active health check loop. It runs until ctx is done.
+func (l *List) Start(ctx context.Context) {
+	l.done = make(chan struct{})
+
+	l.wg.Add(1)
+
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(l.options.ProbeInterval)
+		defer ticker.Stop()
+
+		l.probeAll(ctx)
+
+		for {
+			select {
+			case <-ticker.C:
+				l.probeAll(ctx)
+			case <-ctx.Done():
+				return
+			case <-l.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the health check loop started by Start.
+func (l *List) Stop() {
+	if l.done != nil {
+		close(l.done)
+	}
+
+	l.wg.Wait()
+}
+
+func (l *List) probeAll(ctx context.Context) {
+	all := l.All()
+
+	for _, u := range all {
+		err := l.options.Prober.Probe(ctx, u.Addr())
+
+		wasHealthy := u.Healthy()
+
+		u.setHealthy(err == nil)
+
+		if l.options.OutlierDetection != nil {
+			l.applyOutlierDetection(u, all, err)
+		}
+
+		if wasHealthy != u.Healthy() {
+			if err != nil {
+				l.options.Logger.Warn("upstream health check failed", zap.String("upstream", u.Addr()), zap.Error(err))
+			} else {
+				l.options.Logger.Info("upstream became healthy", zap.String("upstream", u.Addr()))
+			}
+		}
+	}
+}
+
+// applyOutlierDetection updates u's consecutive-failure/ejection state based on the outcome of
+// its latest probe (err), logging eject/reinstate transitions. all is the full snapshot of
+// tracked upstreams, used to enforce MaxEjectionPercent.
+func (l *List) applyOutlierDetection(u *Upstream, all []*Upstream, probeErr error) {
+	cfg := *l.options.OutlierDetection
+
+	if probeErr == nil {
+		if u.recordProbeSuccess(cfg) {
+			l.options.Logger.Info("upstream reinstated after outlier ejection", zap.String("upstream", u.Addr()))
+		}
+
+		return
+	}
+
+	if u.recordProbeFailure(cfg, l.canEject(all, cfg)) {
+		l.options.Logger.Warn("upstream ejected by outlier detection",
+			zap.String("upstream", u.Addr()),
+			zap.Uint32("consecutive_failures", cfg.ConsecutiveFailures),
+		)
+	}
+}
+
+// canEject reports whether one more upstream may be ejected without exceeding
+// cfg.MaxEjectionPercent of all tracked upstreams.
+func (l *List) canEject(all []*Upstream, cfg OutlierConfig) bool {
+	if len(all) == 0 {
+		return true
+	}
+
+	ejected := 1
+
+	for _, u := range all {
+		if u.Ejected() {
+			ejected++
+		}
+	}
+
+	return ejected*100 <= cfg.MaxEjectionPercent*len(all)
+}
+
+// EjectedEndpoints returns the addresses of upstreams currently ejected by outlier detection, in
+// sorted order.
+func (l *List) EjectedEndpoints() []string {
+	all := l.All()
+
+	addrs := make([]string, 0, len(all))
+
+	for _, u := range all {
+		if u.Ejected() {
+			addrs = append(addrs, u.Addr())
+		}
+	}
+
+	sort.Strings(addrs)
+
+	return addrs
+}
@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+func listenTCP(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close() //nolint:errcheck
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// fakeProber reports upstreams in healthyAddrs as healthy and everything else as unhealthy.
+type fakeProber struct {
+	healthyAddrs map[string]bool
+}
+
+func (f fakeProber) Probe(_ context.Context, addr string) error {
+	if f.healthyAddrs[addr] {
+		return nil
+	}
+
+	return errors.New("unhealthy")
+}
+
+func TestListHealthyReflectsProber(t *testing.T) {
+	t.Parallel()
+
+	list := upstream.NewList(
+		upstream.WithProbeInterval(10 * time.Millisecond),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(listenTCP(t), listenTCP(t))))
+
+	assert.False(t, list.Healthy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, list.Healthy, time.Second, 5*time.Millisecond)
+}
+
+func TestListPickSkipsUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	list := upstream.NewList(
+		upstream.WithProber(fakeProber{healthyAddrs: map[string]bool{"127.0.0.1:1": true}}),
+		upstream.WithProbeInterval(10*time.Millisecond),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf("127.0.0.1:1", "127.0.0.1:2")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, func() bool {
+		u := list.Pick(upstream.PickHint{})
+
+		return u != nil && u.Addr() == "127.0.0.1:1"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func seqOf(values ...string) func(func(string) bool) {
+	return func(yield func(string) bool) {
+		for _, v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream
+
+import "time"
+
+// OutlierConfig configures outlier detection (passive circuit-breaking) for a List.
+type OutlierConfig struct {
+	// ConsecutiveFailures is the number of consecutive failed health checks after which an
+	// upstream is ejected from selection. Defaults to 5.
+	ConsecutiveFailures uint32
+	// BaseEjectionTime is the ejection duration applied the first time an upstream is ejected.
+	// Each subsequent ejection doubles the previous duration, up to MaxEjectionTime. Defaults to
+	// 30 seconds.
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the exponential ejection backoff. Defaults to 5 minutes.
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent caps the percentage of all tracked upstreams, counted across every
+	// priority tier, which may be ejected at once. Defaults to 50.
+	MaxEjectionPercent int
+}
+
+// ejectionDuration returns how long an upstream stays ejected after its (ejectionCount)'th
+// ejection, applying exponential backoff capped at MaxEjectionTime.
+func (cfg OutlierConfig) ejectionDuration(ejectionCount uint32) time.Duration {
+	shift := min(ejectionCount-1, 30)
+
+	duration := cfg.BaseEjectionTime << shift
+	if duration <= 0 || duration > cfg.MaxEjectionTime {
+		return cfg.MaxEjectionTime
+	}
+
+	return duration
+}
+
+// OutlierDetectionOption configures an OutlierConfig.
+type OutlierDetectionOption func(*OutlierConfig)
+
+// WithConsecutiveFailures overrides the number of consecutive failed health checks after which an
+// upstream is ejected. Defaults to 5.
+func WithConsecutiveFailures(n uint32) OutlierDetectionOption {
+	return func(cfg *OutlierConfig) {
+		cfg.ConsecutiveFailures = n
+	}
+}
+
+// WithBaseEjectionTime overrides the ejection duration applied the first time an upstream is
+// ejected. Defaults to 30 seconds.
+func WithBaseEjectionTime(d time.Duration) OutlierDetectionOption {
+	return func(cfg *OutlierConfig) {
+		cfg.BaseEjectionTime = d
+	}
+}
+
+// WithMaxEjectionTime overrides the cap on the exponential ejection backoff. Defaults to 5 minutes.
+func WithMaxEjectionTime(d time.Duration) OutlierDetectionOption {
+	return func(cfg *OutlierConfig) {
+		cfg.MaxEjectionTime = d
+	}
+}
+
+// WithMaxEjectionPercent overrides the cap on the percentage of upstreams which may be ejected at
+// once. Defaults to 50.
+func WithMaxEjectionPercent(percent int) OutlierDetectionOption {
+	return func(cfg *OutlierConfig) {
+		cfg.MaxEjectionPercent = percent
+	}
+}
+
+// WithOutlierDetection enables outlier detection: upstreams which accumulate ConsecutiveFailures
+// health check failures are ejected from selection, with exponential backoff before they become
+// eligible for reinstatement on their next successful check.
+func WithOutlierDetection(options ...OutlierDetectionOption) ListOption {
+	cfg := OutlierConfig{
+		ConsecutiveFailures: 5,
+		BaseEjectionTime:    30 * time.Second,
+		MaxEjectionTime:     5 * time.Minute,
+		MaxEjectionPercent:  50,
+	}
+
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	return func(o *Options) {
+		o.OutlierDetection = &cfg
+	}
+}
@@ -0,0 +1,244 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+// flippableProber reports each addr as healthy or unhealthy according to a per-addr switch that
+// the test can flip at will.
+type flippableProber struct {
+	healthy map[string]*atomic.Bool
+}
+
+func newFlippableProber(addrs ...string) flippableProber {
+	healthy := make(map[string]*atomic.Bool, len(addrs))
+	for _, addr := range addrs {
+		healthy[addr] = &atomic.Bool{}
+	}
+
+	return flippableProber{healthy: healthy}
+}
+
+func (f flippableProber) set(addr string, healthy bool) {
+	f.healthy[addr].Store(healthy)
+}
+
+func (f flippableProber) Probe(_ context.Context, addr string) error {
+	if f.healthy[addr].Load() {
+		return nil
+	}
+
+	return errors.New("unhealthy")
+}
+
+func TestOutlierDetectionEjectsAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	addr := listenTCP(t)
+
+	prober := newFlippableProber(addr)
+	prober.set(addr, true)
+
+	list := upstream.NewList(
+		upstream.WithProber(prober),
+		upstream.WithProbeInterval(5*time.Millisecond),
+		upstream.WithOutlierDetection(
+			upstream.WithConsecutiveFailures(2),
+			upstream.WithMaxEjectionPercent(100),
+		),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(addr)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, list.Healthy, time.Second, 5*time.Millisecond)
+
+	prober.set(addr, false)
+
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, []string{addr}, list.EjectedEndpoints())
+	// With only one upstream tracked, Healthy falls back to the least-recently-ejected upstream
+	// rather than reporting nothing available; see TestOutlierDetectionFallsBackToLeastRecentlyEjected.
+	assert.True(t, list.Healthy())
+}
+
+func TestOutlierDetectionReinstatesAfterBackoff(t *testing.T) {
+	t.Parallel()
+
+	addr := listenTCP(t)
+
+	prober := newFlippableProber(addr)
+	prober.set(addr, false)
+
+	list := upstream.NewList(
+		upstream.WithProber(prober),
+		upstream.WithProbeInterval(5*time.Millisecond),
+		upstream.WithOutlierDetection(
+			upstream.WithConsecutiveFailures(2),
+			upstream.WithBaseEjectionTime(20*time.Millisecond),
+			upstream.WithMaxEjectionTime(20*time.Millisecond),
+			upstream.WithMaxEjectionPercent(100),
+		),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(addr)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	prober.set(addr, true)
+
+	// Note: list.Healthy() can't be used to wait here, since with only one upstream tracked it
+	// falls back to reporting healthy as soon as the upstream is ejected (see
+	// TestOutlierDetectionFallsBackToLeastRecentlyEjected) rather than once it is genuinely
+	// reinstated.
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	assert.True(t, list.Healthy())
+}
+
+func TestOutlierDetectionMaxEjectionPercentSafeguard(t *testing.T) {
+	t.Parallel()
+
+	addrA, addrB := listenTCP(t), listenTCP(t)
+
+	prober := newFlippableProber(addrA, addrB)
+
+	list := upstream.NewList(
+		upstream.WithProber(prober),
+		upstream.WithProbeInterval(5*time.Millisecond),
+		upstream.WithOutlierDetection(
+			upstream.WithConsecutiveFailures(2),
+			upstream.WithMaxEjectionPercent(50),
+		),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(addrA, addrB)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) > 0
+	}, time.Second, 5*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Len(t, list.EjectedEndpoints(), 1, "MaxEjectionPercent should prevent both upstreams from being ejected at once")
+}
+
+func TestOutlierDetectionFallsBackToLeastRecentlyEjected(t *testing.T) {
+	t.Parallel()
+
+	addr := listenTCP(t)
+
+	prober := newFlippableProber(addr)
+	prober.set(addr, true)
+
+	list := upstream.NewList(
+		upstream.WithProber(prober),
+		upstream.WithProbeInterval(5*time.Millisecond),
+		upstream.WithOutlierDetection(
+			upstream.WithConsecutiveFailures(2),
+			upstream.WithMaxEjectionPercent(100),
+		),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(addr)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, list.Healthy, time.Second, 5*time.Millisecond)
+
+	prober.set(addr, false)
+
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// The only upstream is now ejected, which would otherwise leave the pool empty: Pick and
+	// Healthy should fall back to it rather than failing every connection outright.
+	assert.True(t, list.Healthy(), "Healthy should fall back to the least-recently-ejected upstream rather than report nothing available")
+
+	picked := list.Pick(upstream.PickHint{})
+	require.NotNil(t, picked, "Pick should fall back to the least-recently-ejected upstream")
+	assert.Equal(t, addr, picked.Addr())
+}
+
+func TestOutlierDetectionFallbackNeverReturnsADrainingUpstream(t *testing.T) {
+	t.Parallel()
+
+	addr := listenTCP(t)
+
+	prober := newFlippableProber(addr)
+	prober.set(addr, true)
+
+	list := upstream.NewList(
+		upstream.WithProber(prober),
+		upstream.WithProbeInterval(5*time.Millisecond),
+		upstream.WithOutlierDetection(
+			upstream.WithConsecutiveFailures(2),
+			upstream.WithMaxEjectionPercent(100),
+		),
+	)
+
+	require.NoError(t, list.Reconcile(seqOf(addr)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	list.Start(ctx)
+	t.Cleanup(list.Stop)
+
+	require.Eventually(t, list.Healthy, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, list.Drain(addr))
+
+	prober.set(addr, false)
+
+	require.Eventually(t, func() bool {
+		return len(list.EjectedEndpoints()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// The only upstream is both drained and ejected: Drain's contract that a drained upstream
+	// never receives new connections must win over the outlier-detection fallback.
+	assert.False(t, list.Healthy())
+	assert.Nil(t, list.Pick(upstream.PickHint{}))
+}
@@ -0,0 +1,173 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PickHint carries per-connection context a Policy may use to make its selection.
+type PickHint struct {
+	// ClientAddr is the remote address ("host:port") of the client connection being routed.
+	ClientAddr string
+}
+
+// Policy selects an upstream from conns, which contains only currently healthy upstreams, for a
+// new connection described by hint. Pick returns nil if conns is empty.
+type Policy interface {
+	Pick(conns []*Upstream, hint PickHint) *Upstream
+}
+
+func sortedByAddr(conns []*Upstream) []*Upstream {
+	sorted := slices.Clone(conns)
+
+	slices.SortFunc(sorted, func(a, b *Upstream) int {
+		return strings.Compare(a.Addr(), b.Addr())
+	})
+
+	return sorted
+}
+
+// RoundRobinPolicy picks upstreams using smooth weighted round-robin, the algorithm Nginx uses for
+// its default upstream balancing: every pick, each upstream's current weight is increased by its
+// effective weight, the upstream with the highest current weight is chosen, and the sum of all
+// effective weights is subtracted from the chosen upstream's current weight. This distributes
+// picks proportionally to Upstream.Weight while interleaving lighter upstreams between picks of
+// heavier ones, rather than bunching every upstream's picks into one long run per cycle. It is the
+// default policy.
+type RoundRobinPolicy struct {
+	mu      sync.Mutex
+	current map[string]int64
+}
+
+// Pick implements Policy.
+func (p *RoundRobinPolicy) Pick(conns []*Upstream, _ PickHint) *Upstream {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	sorted := sortedByAddr(conns)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil {
+		p.current = map[string]int64{}
+	}
+
+	var (
+		total       int64
+		best        *Upstream
+		bestCurrent int64
+	)
+
+	for _, u := range sorted {
+		weight := int64(u.Weight())
+		if weight <= 0 {
+			weight = 1
+		}
+
+		total += weight
+
+		current := p.current[u.Addr()] + weight
+		p.current[u.Addr()] = current
+
+		if best == nil || current > bestCurrent {
+			best = u
+			bestCurrent = current
+		}
+	}
+
+	p.current[best.Addr()] -= total
+
+	return best
+}
+
+// RandomPolicy picks a uniformly random upstream for each connection.
+type RandomPolicy struct{}
+
+// Pick implements Policy.
+func (RandomPolicy) Pick(conns []*Upstream, _ PickHint) *Upstream {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	return conns[rand.IntN(len(conns))] //nolint:gosec
+}
+
+// LeastConnectionsPolicy picks the upstream with the fewest currently active connections.
+type LeastConnectionsPolicy struct{}
+
+// Pick implements Policy.
+func (LeastConnectionsPolicy) Pick(conns []*Upstream, _ PickHint) *Upstream {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	best := conns[0]
+
+	for _, u := range conns[1:] {
+		if u.ActiveConns() < best.ActiveConns() {
+			best = u
+		}
+	}
+
+	return best
+}
+
+// IPHashPolicy deterministically picks an upstream based on the client's IP address, so that
+// connections from the same client consistently land on the same upstream.
+type IPHashPolicy struct{}
+
+// Pick implements Policy.
+func (IPHashPolicy) Pick(conns []*Upstream, hint PickHint) *Upstream {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	sorted := sortedByAddr(conns)
+
+	host := hint.ClientAddr
+	if h, _, err := net.SplitHostPort(hint.ClientAddr); err == nil {
+		host = h
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+
+	return sorted[h.Sum32()%uint32(len(sorted))]
+}
+
+// EWMAPolicy picks the upstream with the lowest exponentially-weighted moving average dial
+// latency, preferring upstreams with no recorded latency yet so they get a chance to be measured.
+type EWMAPolicy struct{}
+
+// Pick implements Policy.
+func (EWMAPolicy) Pick(conns []*Upstream, _ PickHint) *Upstream {
+	if len(conns) == 0 {
+		return nil
+	}
+
+	best := conns[0]
+
+	for _, u := range conns[1:] {
+		bestLatency := best.EWMALatency()
+		if bestLatency == 0 {
+			// best has no measurement yet; give it a chance before considering others.
+			continue
+		}
+
+		if latency := u.EWMALatency(); latency == 0 || latency < bestLatency {
+			best = u
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+func TestRoundRobinPolicyCyclesInAddrOrder(t *testing.T) {
+	t.Parallel()
+
+	conns := buildUpstreams(t, "127.0.0.1:3", "127.0.0.1:1", "127.0.0.1:2")
+
+	policy := &upstream.RoundRobinPolicy{}
+
+	var picked []string
+	for range 6 {
+		picked = append(picked, policy.Pick(conns, upstream.PickHint{}).Addr())
+	}
+
+	assert.Equal(t, []string{
+		"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3",
+		"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3",
+	}, picked)
+}
+
+func TestRoundRobinPolicyEmpty(t *testing.T) {
+	t.Parallel()
+
+	policy := &upstream.RoundRobinPolicy{}
+	assert.Nil(t, policy.Pick(nil, upstream.PickHint{}))
+}
+
+func TestLeastConnectionsPolicyPicksLeastLoaded(t *testing.T) {
+	t.Parallel()
+
+	conns := buildUpstreams(t, "127.0.0.1:1", "127.0.0.1:2")
+
+	conns[0].IncActiveConns()
+	conns[0].IncActiveConns()
+	conns[1].IncActiveConns()
+
+	policy := upstream.LeastConnectionsPolicy{}
+	assert.Equal(t, conns[1].Addr(), policy.Pick(conns, upstream.PickHint{}).Addr())
+}
+
+func TestIPHashPolicyIsStable(t *testing.T) {
+	t.Parallel()
+
+	conns := buildUpstreams(t, "127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3")
+
+	policy := upstream.IPHashPolicy{}
+
+	first := policy.Pick(conns, upstream.PickHint{ClientAddr: "10.0.0.5:54321"})
+	for range 10 {
+		again := policy.Pick(conns, upstream.PickHint{ClientAddr: "10.0.0.5:9999"})
+		assert.Equal(t, first.Addr(), again.Addr())
+	}
+}
+
+func TestEWMAPolicyPrefersUnmeasuredThenFaster(t *testing.T) {
+	t.Parallel()
+
+	conns := buildUpstreams(t, "127.0.0.1:1", "127.0.0.1:2")
+
+	policy := upstream.EWMAPolicy{}
+
+	// neither has a measurement yet: the first one is kept.
+	assert.Equal(t, conns[0].Addr(), policy.Pick(conns, upstream.PickHint{}).Addr())
+
+	conns[0].RecordLatency(100 * time.Millisecond)
+	conns[1].RecordLatency(10 * time.Millisecond)
+
+	assert.Equal(t, conns[1].Addr(), policy.Pick(conns, upstream.PickHint{}).Addr())
+}
+
+func buildUpstreams(t *testing.T, addrs ...string) []*upstream.Upstream {
+	t.Helper()
+
+	list := upstream.NewList()
+	require.NoError(t, list.Reconcile(seqOf(addrs...)))
+
+	return list.All()
+}
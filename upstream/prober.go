@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Prober actively checks whether an upstream at addr ("host:port") is healthy.
+type Prober interface {
+	Probe(ctx context.Context, addr string) error
+}
+
+// TCPProber is the default Prober: an upstream is considered healthy if a TCP connection can be
+// established within Timeout.
+type TCPProber struct {
+	// Timeout bounds each dial attempt.
+	Timeout time.Duration
+}
+
+// Probe implements Prober.
+func (p TCPProber) Probe(ctx context.Context, addr string) error {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// HTTPHealthCheckConfig configures an HTTPProber.
+type HTTPHealthCheckConfig struct {
+	// Path is the HTTP path probed on each upstream, e.g. "/readyz" for a Kubernetes API server.
+	Path string
+	// Scheme is either "http" or "https".
+	Scheme string
+	// ExpectedStatusCodes lists the status codes considered healthy. Defaults to [200].
+	ExpectedStatusCodes []int
+	// Timeout bounds each probe request.
+	Timeout time.Duration
+	// BearerToken, if set, is sent as an Authorization: Bearer header.
+	BearerToken string
+	// InsecureSkipVerify disables TLS certificate verification, e.g. for self-signed
+	// Kubernetes API server certificates.
+	InsecureSkipVerify bool
+	// TLSConfig, if set, is cloned and used as the base TLS client configuration for probing,
+	// e.g. to present a client certificate for mTLS or to trust a private CA pool. If
+	// InsecureSkipVerify is also set, it takes precedence over TLSConfig.InsecureSkipVerify.
+	TLSConfig *tls.Config
+}
+
+// HTTPHealthCheckOption configures an HTTPHealthCheckConfig.
+type HTTPHealthCheckOption func(*HTTPHealthCheckConfig)
+
+// WithHTTPHealthCheckPath sets the path probed on each upstream. Defaults to "/readyz".
+func WithHTTPHealthCheckPath(path string) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.Path = path
+	}
+}
+
+// WithHTTPHealthCheckScheme sets the scheme ("http" or "https") used to probe each upstream.
+// Defaults to "https".
+func WithHTTPHealthCheckScheme(scheme string) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.Scheme = scheme
+	}
+}
+
+// WithHTTPHealthCheckExpectedStatusCodes overrides the set of status codes considered healthy.
+// Defaults to [200].
+func WithHTTPHealthCheckExpectedStatusCodes(codes ...int) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.ExpectedStatusCodes = codes
+	}
+}
+
+// WithHTTPHealthCheckTimeout bounds each probe request. Defaults to 3 seconds.
+func WithHTTPHealthCheckTimeout(timeout time.Duration) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.Timeout = timeout
+	}
+}
+
+// WithHTTPHealthCheckBearerToken attaches a bearer token to each probe request, as required by
+// Kubernetes API servers that enforce authenticated readiness checks.
+func WithHTTPHealthCheckBearerToken(token string) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.BearerToken = token
+	}
+}
+
+// WithHTTPHealthCheckInsecureSkipVerify disables TLS certificate verification when probing.
+func WithHTTPHealthCheckInsecureSkipVerify(skip bool) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.InsecureSkipVerify = skip
+	}
+}
+
+// WithHTTPHealthCheckTLSConfig sets a custom TLS client configuration used when probing over
+// HTTPS, e.g. a client certificate for mTLS, a private CA pool, or a ServerName override. It is
+// cloned before use, so later changes to the passed config have no effect.
+func WithHTTPHealthCheckTLSConfig(config *tls.Config) HTTPHealthCheckOption {
+	return func(c *HTTPHealthCheckConfig) {
+		c.TLSConfig = config
+	}
+}
+
+// HTTPProber is a Prober which issues an HTTP(S) GET against a fixed path on each upstream,
+// e.g. a Kubernetes API server's "/readyz" endpoint.
+type HTTPProber struct {
+	config HTTPHealthCheckConfig
+	client *http.Client
+}
+
+// NewHTTPProber builds an HTTPProber from options.
+func NewHTTPProber(options ...HTTPHealthCheckOption) *HTTPProber {
+	config := HTTPHealthCheckConfig{
+		Path:                "/readyz",
+		Scheme:              "https",
+		ExpectedStatusCodes: []int{http.StatusOK},
+		Timeout:             3 * time.Second,
+	}
+
+	for _, option := range options {
+		option(&config)
+	}
+
+	tlsConfig := &tls.Config{} //nolint:gosec
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+
+	if config.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+	}
+
+	return &HTTPProber{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+}
+
+// Probe implements Prober.
+func (p *HTTPProber) Probe(ctx context.Context, addr string) error {
+	url := fmt.Sprintf("%s://%s%s", p.config.Scheme, addr, p.config.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	if p.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.BearerToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	for _, code := range p.config.ExpectedStatusCodes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected status code %d probing %s", resp.StatusCode, url)
+}
@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package upstream_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-loadbalancer/upstream"
+)
+
+func TestTCPProberHealthyAndUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close() //nolint:errcheck
+		}
+	}()
+
+	prober := upstream.TCPProber{}
+
+	assert.NoError(t, prober.Probe(context.Background(), ln.Addr().String()))
+
+	closedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := closedLn.Addr().String()
+	require.NoError(t, closedLn.Close())
+
+	assert.Error(t, prober.Probe(context.Background(), addr))
+}
+
+func TestHTTPProberReadyz(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	addr := srv.Listener.Addr().String()
+
+	prober := upstream.NewHTTPProber(
+		upstream.WithHTTPHealthCheckScheme("http"),
+		upstream.WithHTTPHealthCheckBearerToken("test-token"),
+	)
+
+	assert.NoError(t, prober.Probe(context.Background(), addr))
+
+	unauthenticated := upstream.NewHTTPProber(upstream.WithHTTPHealthCheckScheme("http"))
+	assert.Error(t, unauthenticated.Probe(context.Background(), addr))
+}
+
+func TestHTTPProberTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	addr := srv.Listener.Addr().String()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	trusted := upstream.NewHTTPProber(
+		upstream.WithHTTPHealthCheckTLSConfig(&tls.Config{RootCAs: pool}), //nolint:gosec
+	)
+	assert.NoError(t, trusted.Probe(context.Background(), addr), "a caller-supplied CA pool should be trusted")
+
+	untrusted := upstream.NewHTTPProber()
+	assert.Error(t, untrusted.Probe(context.Background(), addr), "without the CA pool or InsecureSkipVerify, the self-signed cert should be rejected")
+}
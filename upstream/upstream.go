@@ -0,0 +1,209 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package upstream provides health-checked upstream endpoint management for loadbalancer.TCP.
+package upstream
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ewmaDecay weights the previous EWMA latency estimate against each new sample.
+const ewmaDecay = 0.8
+
+// Upstream represents a single dial target tracked by a List.
+type Upstream struct {
+	host string
+	port int
+
+	healthy  atomic.Bool
+	draining atomic.Bool
+
+	activeConns atomic.Int64
+
+	latencyMu     sync.Mutex
+	ewmaLatencyMs float64
+
+	weight   atomic.Uint32
+	priority atomic.Uint32
+
+	outlierMu           sync.Mutex
+	consecutiveFailures uint32
+	ejected             bool
+	ejectionCount       uint32
+	ejectedAt           time.Time
+}
+
+// newUpstream creates an Upstream for host:port, starting out as unhealthy until the first
+// successful probe, with weight 1 and priority 0.
+func newUpstream(host string, port int) *Upstream {
+	u := &Upstream{
+		host: host,
+		port: port,
+	}
+
+	u.weight.Store(1)
+
+	return u
+}
+
+// Host returns the upstream's host.
+func (u *Upstream) Host() string {
+	return u.host
+}
+
+// Port returns the upstream's port.
+func (u *Upstream) Port() int {
+	return u.port
+}
+
+// Addr returns the upstream as a "host:port" string suitable for dialing.
+func (u *Upstream) Addr() string {
+	return net.JoinHostPort(u.host, strconv.Itoa(u.port))
+}
+
+// Healthy reports whether the upstream currently passes its health check, is not draining, and
+// has not been ejected by outlier detection.
+func (u *Upstream) Healthy() bool {
+	return u.healthy.Load() && !u.draining.Load() && !u.Ejected()
+}
+
+func (u *Upstream) setHealthy(healthy bool) {
+	u.healthy.Store(healthy)
+}
+
+// Draining reports whether the upstream has been removed from selection via List.Drain.
+func (u *Upstream) Draining() bool {
+	return u.draining.Load()
+}
+
+func (u *Upstream) setDraining(draining bool) {
+	u.draining.Store(draining)
+}
+
+// Weight returns the upstream's selection weight within its priority tier. Defaults to 1.
+func (u *Upstream) Weight() uint32 {
+	return u.weight.Load()
+}
+
+func (u *Upstream) setWeight(weight uint32) {
+	if weight == 0 {
+		weight = 1
+	}
+
+	u.weight.Store(weight)
+}
+
+// Priority returns the upstream's priority tier. Lower values are preferred; defaults to 0.
+func (u *Upstream) Priority() uint32 {
+	return u.priority.Load()
+}
+
+func (u *Upstream) setPriority(priority uint32) {
+	u.priority.Store(priority)
+}
+
+// IncActiveConns records that a new connection has been routed to the upstream. Used by
+// LeastConnectionsPolicy to pick the least-loaded upstream.
+func (u *Upstream) IncActiveConns() {
+	u.activeConns.Add(1)
+}
+
+// DecActiveConns records that a connection previously routed to the upstream has closed.
+func (u *Upstream) DecActiveConns() {
+	u.activeConns.Add(-1)
+}
+
+// ActiveConns returns the number of connections currently routed to the upstream.
+func (u *Upstream) ActiveConns() int64 {
+	return u.activeConns.Load()
+}
+
+// RecordLatency folds a new dial latency sample into the upstream's EWMA latency estimate. Used
+// by EWMAPolicy to prefer upstreams which have recently responded faster.
+func (u *Upstream) RecordLatency(d time.Duration) {
+	ms := float64(d.Milliseconds())
+
+	u.latencyMu.Lock()
+	defer u.latencyMu.Unlock()
+
+	if u.ewmaLatencyMs == 0 {
+		u.ewmaLatencyMs = ms
+
+		return
+	}
+
+	u.ewmaLatencyMs = ewmaDecay*u.ewmaLatencyMs + (1-ewmaDecay)*ms
+}
+
+// EWMALatency returns the upstream's current EWMA latency estimate, or zero if no sample has
+// been recorded yet.
+func (u *Upstream) EWMALatency() time.Duration {
+	u.latencyMu.Lock()
+	defer u.latencyMu.Unlock()
+
+	return time.Duration(u.ewmaLatencyMs * float64(time.Millisecond))
+}
+
+// Ejected reports whether outlier detection has currently ejected the upstream from selection.
+func (u *Upstream) Ejected() bool {
+	u.outlierMu.Lock()
+	defer u.outlierMu.Unlock()
+
+	return u.ejected
+}
+
+// ejectedSince reports when u was last ejected by outlier detection, and whether it is currently
+// ejected at all.
+func (u *Upstream) ejectedSince() (time.Time, bool) {
+	u.outlierMu.Lock()
+	defer u.outlierMu.Unlock()
+
+	return u.ejectedAt, u.ejected
+}
+
+// recordProbeSuccess resets the consecutive failure count. It returns true if the success ended
+// an ejection that had outlasted its backoff, in which case the upstream is reinstated.
+func (u *Upstream) recordProbeSuccess(cfg OutlierConfig) bool {
+	u.outlierMu.Lock()
+	defer u.outlierMu.Unlock()
+
+	u.consecutiveFailures = 0
+
+	if !u.ejected || time.Since(u.ejectedAt) < cfg.ejectionDuration(u.ejectionCount) {
+		return false
+	}
+
+	u.ejected = false
+
+	return true
+}
+
+// recordProbeFailure increments the consecutive failure count and ejects the upstream once it
+// reaches cfg.ConsecutiveFailures, unless allowEject is false (the MaxEjectionPercent safeguard).
+// It returns true if this call ejected the upstream.
+func (u *Upstream) recordProbeFailure(cfg OutlierConfig, allowEject bool) bool {
+	u.outlierMu.Lock()
+	defer u.outlierMu.Unlock()
+
+	if u.ejected {
+		return false
+	}
+
+	u.consecutiveFailures++
+
+	if u.consecutiveFailures < cfg.ConsecutiveFailures || !allowEject {
+		return false
+	}
+
+	u.ejected = true
+	u.ejectionCount++
+	u.ejectedAt = time.Now()
+
+	return true
+}